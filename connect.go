@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// connectAllowed reports whether hostport (e.g. "mailrelay.sec3.net:2525")
+// matches one of the connect_allow glob patterns (e.g. "*.onion:443").
+func connectAllowed(allow []string, hostport string) bool {
+	for _, pattern := range allow {
+		if ok, err := path.Match(pattern, hostport); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// idleCopy copies from src to dst like io.Copy, but enforces idle rather
+// than an absolute deadline: each read gets a fresh idle window, so an active
+// tunnel (e.g. a large mail relayed over Tor) can run indefinitely while a
+// genuinely stalled side is still cut off after idle of silence.
+func idleCopy(dst, src net.Conn, idle time.Duration) error {
+	buf := make([]byte, 32*1024)
+	for {
+		if err := src.SetReadDeadline(time.Now().Add(idle)); err != nil {
+			return err
+		}
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleCONNECT parses an HTTP CONNECT request already sniffed off reader,
+// checks the destination against connect_allow, dials it through the chosen
+// SOCKS5 backend, and splices bytes both ways once the tunnel is up. This
+// lets MUA/SMTP clients that speak HTTP CONNECT reach yamn-proxy and have
+// the tunnel routed over the same upstreams as handleHTTP/handleSMTP.
+func handleCONNECT(reader *bufio.Reader, client net.Conn, logger Logger) {
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		logger.Eventf("⚠️ CONNECT parse error: %v", err)
+		return
+	}
+
+	hostport := req.URL.Host
+	if hostport == "" {
+		hostport = req.Host
+	}
+	if !strings.Contains(hostport, ":") {
+		hostport += ":443"
+	}
+
+	cfg := currentConfig()
+	if !connectAllowed(cfg.connectAllow, hostport) {
+		logger.Eventf("❌ CONNECT target not in connect_allow: %s", hostport)
+		fmt.Fprint(client, "HTTP/1.1 403 Forbidden\r\n\r\n")
+		return
+	}
+
+	dialer, backend, err := cfg.pool.Get(hostport)
+	if err != nil {
+		logger.Eventf("⚠️ Proxy error: %v", err)
+		fmt.Fprint(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	logger.Eventf("🔀 CONNECT %s via backend %s (%s)", hostport, backend.Name, backend.Addr)
+
+	target, err := dialer.Dial("tcp", hostport)
+	if err != nil {
+		logger.Eventf("⚠️ CONNECT dial failed: %v", err)
+		fmt.Fprint(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer target.Close()
+
+	if _, err := fmt.Fprint(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		logger.Eventf("⚠️ CONNECT response write error: %v", err)
+		return
+	}
+
+	// Clear the InitialTimeout deadline from handleConnection's sniff step;
+	// idleCopy manages deadlines itself for the life of the tunnel.
+	client.SetDeadline(time.Time{})
+	if tcpTarget, ok := target.(*net.TCPConn); ok {
+		tcpTarget.SetKeepAlive(true)
+		tcpTarget.SetKeepAlivePeriod(30 * time.Second)
+	}
+	if tcpClient, ok := client.(*net.TCPConn); ok {
+		tcpClient.SetKeepAlive(true)
+		tcpClient.SetKeepAlivePeriod(30 * time.Second)
+	}
+
+	logger.Eventf("🔗 CONNECT tunnel established")
+
+	errChan := make(chan error, 2)
+	go func() {
+		errChan <- idleCopy(target, client, IoTimeout)
+	}()
+	go func() {
+		errChan <- idleCopy(client, target, IoTimeout)
+	}()
+
+	if err := <-errChan; err != nil {
+		logger.Eventf("⚠️ CONNECT tunnel error: %v", err)
+	}
+
+	logger.Eventf("✅ CONNECT tunnel closed")
+}
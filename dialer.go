@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+func init() {
+	proxy.RegisterDialerType("http", newHTTPConnectDialer)
+}
+
+// httpConnectDialer is a proxy.Dialer that tunnels through a plain HTTP
+// CONNECT proxy, registered under the "http" scheme so proxy.FromURL can
+// build one as a link in a proxy_chain.
+type httpConnectDialer struct {
+	addr    string
+	forward proxy.Dialer
+}
+
+func newHTTPConnectDialer(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	return &httpConnectDialer{addr: u.Host, forward: forward}, nil
+}
+
+func (d *httpConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := d.forward.Dial(network, d.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("http connect proxy %s: unexpected status %s", d.addr, resp.Status)
+	}
+	return conn, nil
+}
+
+// buildChainDialer composes proxy_chain into a single dialer, each entry
+// wrapping the previous one as its forward dialer: the first entry is dialed
+// directly and each later entry is reached through the ones before it, e.g.
+// [socks5://127.0.0.1:9050, http://corp-proxy:3128] reaches corp-proxy
+// through Tor and then has it CONNECT to the target.
+func buildChainDialer(chain []string) (proxy.Dialer, error) {
+	var dialer proxy.Dialer = proxy.Direct
+	for _, link := range chain {
+		u, err := url.Parse(link)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy_chain entry %q: %w", link, err)
+		}
+		next, err := proxy.FromURL(u, dialer)
+		if err != nil {
+			return nil, fmt.Errorf("building dialer for proxy_chain entry %q: %w", link, err)
+		}
+		dialer = next
+	}
+	return dialer, nil
+}
+
+// resolveUpstreamDialer returns the dialer upstream connections should use
+// when proxy_chain or proxy_from_env override the pool's normal per-backend
+// SOCKS5 dialing, or nil when neither is configured (the pool then dials
+// each backend's proxy_addr directly, as before).
+func resolveUpstreamDialer(chain []string, fromEnv bool) (proxy.Dialer, error) {
+	if len(chain) > 0 {
+		return buildChainDialer(chain)
+	}
+	if fromEnv {
+		return proxy.FromEnvironment(), nil
+	}
+	return nil, nil
+}
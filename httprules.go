@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// HttpRule is one entry of the `http_rules:` YAML list. Match is applied
+// against "host/path" and Rewrite may reference its capture groups ($1, $2, ...).
+type HttpRule struct {
+	Match   string   `yaml:"match"`
+	Rewrite string   `yaml:"rewrite"`
+	Methods []string `yaml:"methods"`
+	Via     string   `yaml:"via"`
+}
+
+// compiledRule is an HttpRule with its regexp pre-compiled and its method
+// list turned into a set for quick lookup.
+type compiledRule struct {
+	re      *regexp.Regexp
+	rewrite string
+	methods map[string]bool
+	via     string
+}
+
+// httpRules is not assigned anywhere; the rules in effect are held in
+// liveConfig.httpRules, which is swapped on reload.
+var httpRules []compiledRule
+
+// compileHttpRules compiles rules from config, in order, followed by the legacy
+// httpTargets exact-match map compiled into trivial rules, so existing
+// yamn-proxy.yml files keep working unchanged.
+func compileHttpRules(rules []HttpRule, legacyTargets map[string]string) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules)+len(legacyTargets))
+
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("compiling http_rules match %q: %w", r.Match, err)
+		}
+
+		var methods map[string]bool
+		if len(r.Methods) > 0 {
+			methods = make(map[string]bool, len(r.Methods))
+			for _, m := range r.Methods {
+				methods[m] = true
+			}
+		}
+
+		compiled = append(compiled, compiledRule{
+			re:      re,
+			rewrite: r.Rewrite,
+			methods: methods,
+			via:     r.Via,
+		})
+	}
+
+	// Sugar: compile the legacy exact-match map into trivial rules so both
+	// config styles can coexist.
+	for from, to := range legacyTargets {
+		compiled = append(compiled, compiledRule{
+			re:      regexp.MustCompile("^" + regexp.QuoteMeta(from) + "$"),
+			rewrite: to,
+			methods: nil, // nil means "any method"
+		})
+	}
+
+	return compiled, nil
+}
+
+// matchHttpRule returns the rewritten target URL and the backend label to use for
+// requestedURL and method, or ok=false if no rule matches.
+func matchHttpRule(rules []compiledRule, requestedURL, method string) (target string, via string, ok bool) {
+	for _, rule := range rules {
+		if rule.methods != nil && !rule.methods[method] {
+			continue
+		}
+		if !rule.re.MatchString(requestedURL) {
+			continue
+		}
+		return rule.re.ReplaceAllString(requestedURL, rule.rewrite), rule.via, true
+	}
+	return "", "", false
+}
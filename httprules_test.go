@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestCompileHttpRulesMethodsNilWhenUnset(t *testing.T) {
+	compiled, err := compileHttpRules([]HttpRule{{Match: "^example.com/$", Rewrite: "https://example.com/"}}, nil)
+	if err != nil {
+		t.Fatalf("compileHttpRules: %v", err)
+	}
+	if compiled[0].methods != nil {
+		t.Fatalf("methods = %v, want nil when http_rules entry omits methods:", compiled[0].methods)
+	}
+}
+
+func TestCompileHttpRulesInvalidRegex(t *testing.T) {
+	if _, err := compileHttpRules([]HttpRule{{Match: "(", Rewrite: "x"}}, nil); err == nil {
+		t.Fatal("expected error for invalid match regex, got nil")
+	}
+}
+
+func TestMatchHttpRule(t *testing.T) {
+	compiled, err := compileHttpRules([]HttpRule{
+		{Match: `^example\.com/api/(.*)$`, Rewrite: "https://api.example.com/$1", Methods: []string{"GET"}, Via: "tor1"},
+		{Match: `^example\.com/(.*)$`, Rewrite: "https://example.com/$1"},
+	}, map[string]string{"dummy.tld/pubring.mix": "https://www.harmsk.com/yamn/pubring.mix"})
+	if err != nil {
+		t.Fatalf("compileHttpRules: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		url        string
+		method     string
+		wantTarget string
+		wantVia    string
+		wantOK     bool
+	}{
+		{"rule with methods matches allowed method", "example.com/api/accounts", "GET", "https://api.example.com/accounts", "tor1", true},
+		{"rule with methods rejects other method, falls through", "example.com/api/accounts", "POST", "https://example.com/api/accounts", "", true},
+		{"rule without methods matches any method", "example.com/home", "POST", "https://example.com/home", "", true},
+		{"legacy exact-match sugar still works", "dummy.tld/pubring.mix", "GET", "https://www.harmsk.com/yamn/pubring.mix", "", true},
+		{"no rule matches", "unrouted.tld/x", "GET", "", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, via, ok := matchHttpRule(compiled, tc.url, tc.method)
+			if ok != tc.wantOK || target != tc.wantTarget || via != tc.wantVia {
+				t.Fatalf("matchHttpRule(%q, %q) = (%q, %q, %v), want (%q, %q, %v)",
+					tc.url, tc.method, target, via, ok, tc.wantTarget, tc.wantVia, tc.wantOK)
+			}
+		})
+	}
+}
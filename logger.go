@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Logger is the per-connection sink for everything yamn-proxy logs: the
+// free-form events that used to be io.WriteString(log, "emoji...") calls,
+// the one-line-per-request summary (verbose >= 1), full header/body dumps
+// (verbose >= 2), and SMTP command tracing. Swap in a different
+// implementation (e.g. one emitting JSON) to feed a log shipper instead.
+type Logger interface {
+	Eventf(format string, args ...interface{})
+	HTTPSummary(method, requestedURL, rewrittenURL, backend string, status int, dur time.Duration)
+	HTTPDumpRequest(req *http.Request)
+	HTTPDumpResponse(resp *http.Response)
+	SMTPTrace(line string)
+}
+
+// TextLogger is the default Logger: human-readable lines written to w,
+// colorized by HTTP status class when w is a terminal.
+type TextLogger struct {
+	w             io.Writer
+	verbose       int
+	smtpTraceBody bool
+	color         bool
+}
+
+// NewTextLogger builds a Logger writing to w at the given verbose level
+// (0: Eventf lines only, 1: + one summary line per request and SMTP tracing,
+// 2: + full header/body dumps).
+func NewTextLogger(w io.Writer, verbose int, smtpTraceBody bool) *TextLogger {
+	return &TextLogger{w: w, verbose: verbose, smtpTraceBody: smtpTraceBody, color: isTerminal(w)}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Eventf logs a free-form line, unconditionally of verbose level, matching
+// the old ad-hoc io.WriteString(log, "...") behavior.
+func (l *TextLogger) Eventf(format string, args ...interface{}) {
+	fmt.Fprintf(l.w, format+"\n", args...)
+}
+
+// HTTPSummary logs the compact verbose=1 line: method, host+path, rewritten
+// URL, upstream backend, status, duration.
+func (l *TextLogger) HTTPSummary(method, requestedURL, rewrittenURL, backend string, status int, dur time.Duration) {
+	if l.verbose < 1 {
+		return
+	}
+	statusText := l.colorizeStatus(status, fmt.Sprintf("%d", status))
+	fmt.Fprintf(l.w, "%s %s -> %s via %s [%s] %s\n", method, requestedURL, rewrittenURL, backend, statusText, dur)
+}
+
+// HTTPDumpRequest logs the full outgoing request headers at verbose=2.
+func (l *TextLogger) HTTPDumpRequest(req *http.Request) {
+	if l.verbose < 2 {
+		return
+	}
+
+	dump, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		fmt.Fprintf(l.w, "⚠️ could not dump request: %v\n", err)
+		return
+	}
+	fmt.Fprintf(l.w, "--- request ---\n%s\n", dump)
+}
+
+// HTTPDumpResponse logs full response headers at verbose=2, auto-decoding
+// gzip/deflate bodies.
+func (l *TextLogger) HTTPDumpResponse(resp *http.Response) {
+	if l.verbose < 2 {
+		return
+	}
+
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		fmt.Fprintf(l.w, "⚠️ could not dump response: %v\n", err)
+		return
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		fmt.Fprintf(l.w, "--- response ---\n%s(body undecodable: %v)\n", dump, err)
+		return
+	}
+
+	fmt.Fprintf(l.w, "--- response ---\n%s%s\n", dump, body)
+}
+
+func decodeBody(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	var reader io.Reader = bytes.NewReader(body)
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		reader = flate.NewReader(reader)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// SMTPTrace logs one EHLO/MAIL FROM/RCPT TO/DATA line at verbose=1+.
+// It logs whatever line it is given; smtpCommandTracer passes message body
+// lines to it only when smtpTraceBody is set.
+func (l *TextLogger) SMTPTrace(line string) {
+	if l.verbose < 1 {
+		return
+	}
+	fmt.Fprintf(l.w, "✉️ %s\n", line)
+}
+
+// statusColor returns the ANSI SGR code for an HTTP status class.
+func statusColor(code int) string {
+	switch {
+	case code >= 200 && code < 300:
+		return "32" // green
+	case code >= 300 && code < 400:
+		return "33" // yellow
+	case code >= 400 && code < 500:
+		return "35" // magenta
+	default:
+		return "31" // red
+	}
+}
+
+func (l *TextLogger) colorizeStatus(code int, s string) string {
+	if !l.color {
+		return s
+	}
+	return "\x1b[" + statusColor(code) + "m" + s + "\x1b[0m"
+}
+
+// lineTracer is an io.Writer that buffers partial lines and calls onLine
+// for each complete line it sees, without interrupting whatever is
+// streaming through it (used to tap the SMTP client->target byte stream).
+type lineTracer struct {
+	buf    []byte
+	onLine func(line string)
+}
+
+func (t *lineTracer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	for {
+		idx := bytes.IndexByte(t.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimRight(string(t.buf[:idx]), "\r")
+		t.onLine(line)
+		t.buf = t.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// smtpCommandTracer wraps r so that EHLO/HELO, MAIL FROM, RCPT TO and DATA
+// lines are reported to logger.SMTPTrace as they pass through. Message
+// body lines (after DATA, before the closing ".") are redacted unless
+// smtpTraceBody is set.
+func smtpCommandTracer(r io.Reader, logger Logger, smtpTraceBody bool) io.Reader {
+	inData := false
+	tracer := &lineTracer{onLine: func(line string) {
+		upper := strings.ToUpper(line)
+		switch {
+		case inData:
+			if line == "." {
+				inData = false
+				logger.SMTPTrace("DATA .")
+			} else if smtpTraceBody {
+				logger.SMTPTrace("DATA> " + line)
+			}
+		case strings.HasPrefix(upper, "EHLO") || strings.HasPrefix(upper, "HELO"),
+			strings.HasPrefix(upper, "MAIL FROM"),
+			strings.HasPrefix(upper, "RCPT TO"):
+			logger.SMTPTrace(line)
+		case upper == "DATA":
+			logger.SMTPTrace(line)
+			inData = true
+		}
+	}}
+	return io.TeeReader(r, tracer)
+}
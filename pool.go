@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProxyBackend is a single upstream SOCKS5 endpoint that can be part of the pool.
+type ProxyBackend struct {
+	Name string `yaml:"name"`
+	Addr string `yaml:"addr"`
+
+	healthy  int32 // 0/1, accessed atomically
+	latency  int64 // last probe latency in nanoseconds, accessed atomically
+	failures int32 // consecutive failures, accessed atomically
+}
+
+func (b *ProxyBackend) Healthy() bool {
+	return atomic.LoadInt32(&b.healthy) == 1
+}
+
+func (b *ProxyBackend) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&b.latency))
+}
+
+// ProxyPoolConfig is the `proxy_pool:` section of yamn-proxy.yml.
+type ProxyPoolConfig struct {
+	Backends   []ProxyBackend    `yaml:"backends"`
+	Strategy   string            `yaml:"strategy"`    // round_robin, random, lowest_latency, sticky_by_host
+	CheckURL   string            `yaml:"check_url"`
+	CheckEvery time.Duration     `yaml:"check_every"`
+	Pin        map[string]string `yaml:"pin"` // target host -> backend name
+}
+
+// ProxyPool picks a healthy SOCKS5 backend per request and keeps the pool's
+// health state up to date via periodic probing.
+type ProxyPool struct {
+	backends []*ProxyBackend
+	strategy string
+	checkURL string
+	pin      map[string]string
+
+	// override, when set (via proxy_from_env or proxy_chain), is used for
+	// every dial instead of building a SOCKS5 dialer from a backend's Addr.
+	// Health probing is skipped in that case: the chain/env dialer is
+	// opaque to us, so there's nothing meaningful to probe per backend.
+	override proxy.Dialer
+
+	rrCounter uint64
+	stop      chan struct{}
+}
+
+// NewProxyPool builds a pool from config. If cfg has no backends, the pool
+// falls back to a single backend using ProxyAddr so existing setups keep
+// working unchanged. If override is non-nil (proxy_from_env/proxy_chain),
+// it is used for every dial and health probing is disabled.
+func NewProxyPool(cfg ProxyPoolConfig, override proxy.Dialer) *ProxyPool {
+	p := &ProxyPool{
+		strategy: cfg.Strategy,
+		checkURL: cfg.CheckURL,
+		pin:      cfg.Pin,
+		override: override,
+		stop:     make(chan struct{}),
+	}
+	if p.strategy == "" {
+		p.strategy = "round_robin"
+	}
+
+	backends := cfg.Backends
+	if len(backends) == 0 {
+		backends = []ProxyBackend{{Name: "default", Addr: ProxyAddr}}
+	}
+	for i := range backends {
+		b := backends[i]
+		b.healthy = 1 // assume healthy until the first probe says otherwise
+		p.backends = append(p.backends, &b)
+	}
+
+	if override != nil {
+		return p
+	}
+
+	checkEvery := cfg.CheckEvery
+	if checkEvery <= 0 {
+		checkEvery = 30 * time.Second
+	}
+	go p.probeLoop(checkEvery)
+
+	return p
+}
+
+// Close stops the pool's background health checker.
+func (p *ProxyPool) Close() {
+	close(p.stop)
+}
+
+// Get returns a dialer for host, honoring per-target pinning and falling
+// back to the pool's selection strategy among healthy backends.
+func (p *ProxyPool) Get(host string) (proxy.Dialer, *ProxyBackend, error) {
+	backend := p.pinned(host)
+	if backend == nil {
+		backend = p.pick(host)
+	}
+	if backend == nil {
+		return nil, nil, fmt.Errorf("no healthy proxy backend available")
+	}
+	return p.dialerFor(backend)
+}
+
+// GetVia returns a dialer for the backend named via (e.g. the `via:` label
+// of a matched http_rules entry), falling back to the normal host-based
+// selection when via is empty or names no known backend.
+func (p *ProxyPool) GetVia(via, host string) (proxy.Dialer, *ProxyBackend, error) {
+	if via != "" {
+		for _, b := range p.backends {
+			if b.Name == via {
+				return p.dialerFor(b)
+			}
+		}
+	}
+	return p.Get(host)
+}
+
+func (p *ProxyPool) dialerFor(backend *ProxyBackend) (proxy.Dialer, *ProxyBackend, error) {
+	if p.override != nil {
+		return p.override, backend, nil
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", backend.Addr, nil, &net.Dialer{
+		Timeout:   ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("building dialer for backend %s: %w", backend.Name, err)
+	}
+	return dialer, backend, nil
+}
+
+func (p *ProxyPool) pinned(host string) *ProxyBackend {
+	name, ok := p.pin[host]
+	if !ok {
+		return nil
+	}
+	for _, b := range p.backends {
+		if b.Name == name && b.Healthy() {
+			return b
+		}
+	}
+	return nil
+}
+
+func (p *ProxyPool) pick(host string) *ProxyBackend {
+	healthy := make([]*ProxyBackend, 0, len(p.backends))
+	for _, b := range p.backends {
+		if b.Healthy() {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	switch p.strategy {
+	case "random":
+		return healthy[rand.Intn(len(healthy))]
+	case "lowest_latency":
+		best := healthy[0]
+		for _, b := range healthy[1:] {
+			if b.Latency() < best.Latency() {
+				best = b
+			}
+		}
+		return best
+	case "sticky_by_host":
+		idx := 0
+		for _, c := range host {
+			idx = (idx*31 + int(c)) % len(healthy)
+		}
+		return healthy[idx]
+	default: // round_robin
+		idx := atomic.AddUint64(&p.rrCounter, 1)
+		return healthy[int(idx)%len(healthy)]
+	}
+}
+
+// probeLoop periodically checks every backend's health, backing off
+// exponentially between probes for backends that keep failing.
+func (p *ProxyPool) probeLoop(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	// nextProbe holds the earliest time each backend is probed again: a
+	// backend with n consecutive failures is probed every 2^n ticks (n capped at 6).
+	nextProbe := make(map[*ProxyBackend]time.Time)
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			for _, b := range p.backends {
+				if now.Before(nextProbe[b]) {
+					continue
+				}
+				failures := atomic.LoadInt32(&b.failures)
+				nextProbe[b] = now.Add(time.Duration(1<<uint(min(failures, 6)))*every - every/2)
+				go p.probe(b)
+			}
+		}
+	}
+}
+
+func (p *ProxyPool) probe(b *ProxyBackend) {
+	failures := atomic.LoadInt32(&b.failures)
+	if failures > 0 {
+		backoff := time.Duration(1<<uint(min(failures, 6))) * time.Second
+		time.Sleep(backoff)
+	}
+
+	start := time.Now()
+	err := probeBackend(b, p.checkURL)
+	latency := time.Since(start)
+
+	if err != nil {
+		atomic.AddInt32(&b.failures, 1)
+		atomic.StoreInt32(&b.healthy, 0)
+		log.Printf("⚠️ proxy backend %s (%s) unhealthy: %v", b.Name, b.Addr, err)
+		return
+	}
+
+	atomic.StoreInt32(&b.failures, 0)
+	atomic.StoreInt64(&b.latency, int64(latency))
+	if atomic.SwapInt32(&b.healthy, 1) == 0 {
+		log.Printf("✅ proxy backend %s (%s) healthy again (%s)", b.Name, b.Addr, latency)
+	}
+}
+
+// probeBackend reports whether b is usable. With no check_url configured,
+// it just verifies the backend's SOCKS5 port is reachable directly — dialing
+// through the proxy back to its own address would ask it to CONNECT to
+// itself, which Tor (ClientRejectInternalAddresses) and similar SOCKS5
+// servers refuse by design. With a check_url, it dials through the backend
+// to confirm it can actually reach the wider network.
+func probeBackend(b *ProxyBackend, checkURL string) error {
+	if checkURL == "" {
+		conn, err := net.DialTimeout("tcp", b.Addr, InitialTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", b.Addr, nil, &net.Dialer{Timeout: InitialTimeout})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{Dial: dialer.Dial},
+		Timeout:   InitialTimeout,
+	}
+	resp, err := client.Get(checkURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// Status is the JSON shape served by the /status endpoint.
+type Status struct {
+	Strategy string         `json:"strategy"`
+	Backends []BackendState `json:"backends"`
+}
+
+type BackendState struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Healthy   bool   `json:"healthy"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// StatusJSON returns the pool's current state as JSON, as served on the
+// /status endpoint.
+func (p *ProxyPool) StatusJSON() ([]byte, error) {
+	status := Status{Strategy: p.strategy}
+	for _, b := range p.backends {
+		status.Backends = append(status.Backends, BackendState{
+			Name:      b.Name,
+			Addr:      b.Addr,
+			Healthy:   b.Healthy(),
+			LatencyMs: b.Latency().Milliseconds(),
+		})
+	}
+	return json.Marshal(status)
+}
+
+func min(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBackend(name string, healthy bool, latency time.Duration) *ProxyBackend {
+	b := &ProxyBackend{Name: name, Addr: name + ":9050"}
+	if healthy {
+		b.healthy = 1
+	}
+	atomic.StoreInt64(&b.latency, int64(latency))
+	return b
+}
+
+func TestProxyPoolPickSkipsUnhealthy(t *testing.T) {
+	p := &ProxyPool{
+		strategy: "round_robin",
+		backends: []*ProxyBackend{
+			newTestBackend("a", false, 0),
+			newTestBackend("b", true, 0),
+		},
+	}
+
+	for i := 0; i < 4; i++ {
+		if got := p.pick("host"); got == nil || got.Name != "b" {
+			t.Fatalf("pick() = %v, want backend b (the only healthy one)", got)
+		}
+	}
+}
+
+func TestProxyPoolPickNoHealthyBackends(t *testing.T) {
+	p := &ProxyPool{
+		strategy: "round_robin",
+		backends: []*ProxyBackend{newTestBackend("a", false, 0)},
+	}
+	if got := p.pick("host"); got != nil {
+		t.Fatalf("pick() = %v, want nil when no backend is healthy", got)
+	}
+}
+
+func TestProxyPoolPickRoundRobinCycles(t *testing.T) {
+	p := &ProxyPool{
+		strategy: "round_robin",
+		backends: []*ProxyBackend{
+			newTestBackend("a", true, 0),
+			newTestBackend("b", true, 0),
+		},
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		seen[p.pick("host").Name] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Fatalf("round_robin did not cycle through both backends: %v", seen)
+	}
+}
+
+func TestProxyPoolPickLowestLatency(t *testing.T) {
+	p := &ProxyPool{
+		strategy: "lowest_latency",
+		backends: []*ProxyBackend{
+			newTestBackend("slow", true, 200*time.Millisecond),
+			newTestBackend("fast", true, 20*time.Millisecond),
+		},
+	}
+	if got := p.pick("host"); got == nil || got.Name != "fast" {
+		t.Fatalf("pick() = %v, want backend fast", got)
+	}
+}
+
+func TestProxyPoolPickStickyByHostIsDeterministic(t *testing.T) {
+	p := &ProxyPool{
+		strategy: "sticky_by_host",
+		backends: []*ProxyBackend{
+			newTestBackend("a", true, 0),
+			newTestBackend("b", true, 0),
+			newTestBackend("c", true, 0),
+		},
+	}
+	first := p.pick("mailrelay.sec3.net")
+	for i := 0; i < 5; i++ {
+		if got := p.pick("mailrelay.sec3.net"); got.Name != first.Name {
+			t.Fatalf("sticky_by_host picked %s then %s for the same host", first.Name, got.Name)
+		}
+	}
+}
+
+func TestProxyPoolPinnedHonorsHealth(t *testing.T) {
+	p := &ProxyPool{
+		strategy: "round_robin",
+		pin:      map[string]string{"mailrelay.sec3.net:2525": "pinned"},
+		backends: []*ProxyBackend{
+			newTestBackend("pinned", false, 0),
+			newTestBackend("other", true, 0),
+		},
+	}
+	if got := p.pinned("mailrelay.sec3.net:2525"); got != nil {
+		t.Fatalf("pinned() = %v, want nil because the pinned backend is unhealthy", got)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// liveConfig bundles everything handleConnection, handleHTTP, and handleSMTP
+// need per request, so it can be swapped atomically on config reload.
+type liveConfig struct {
+	httpTargets   map[string]string
+	httpRules     []compiledRule
+	smtpTarget    string
+	pool          *ProxyPool
+	connectAllow  []string
+	verbose       int
+	smtpTraceBody bool
+
+	// localProxy is only read once at startup (see main): changing it in
+	// yamn-proxy.yml requires a restart since the listener is already bound.
+	localProxy string
+}
+
+// live holds the *liveConfig currently in effect.
+var live atomic.Value
+
+// currentConfig returns the live configuration in effect.
+func currentConfig() *liveConfig {
+	return live.Load().(*liveConfig)
+}
+
+// buildLiveConfig reads and validates configPath, returning a fresh
+// liveConfig. It never mutates global state, so a failed reload can be
+// discarded without disturbing what's currently live.
+func buildLiveConfig(configPath string) (*liveConfig, error) {
+	cfg := Config{
+		ProxyAddr:  ProxyAddr,
+		LocalProxy: LocalProxy,
+		SmtpTarget: smtpTarget,
+	}
+
+	if _, err := os.Stat(configPath); err == nil {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", configPath, err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", configPath, err)
+		}
+	}
+
+	// Only fall back to the baked-in default routes when the operator hasn't
+	// configured any routing at all, so an explicit (even empty) http_targets
+	// or http_rules fully replaces them rather than merging on top.
+	if cfg.HttpTargets == nil && len(cfg.HttpRules) == 0 {
+		cfg.HttpTargets = httpTargets
+	}
+
+	rules, err := compileHttpRules(cfg.HttpRules, cfg.HttpTargets)
+	if err != nil {
+		return nil, fmt.Errorf("compiling http_rules: %w", err)
+	}
+
+	poolCfg := cfg.ProxyPool
+	if len(poolCfg.Backends) == 0 {
+		poolCfg.Backends = []ProxyBackend{{Name: "default", Addr: cfg.ProxyAddr}}
+	}
+
+	override, err := resolveUpstreamDialer(cfg.ProxyChain, cfg.ProxyFromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("resolving proxy_chain/proxy_from_env: %w", err)
+	}
+
+	return &liveConfig{
+		httpTargets:   cfg.HttpTargets,
+		httpRules:     rules,
+		smtpTarget:    cfg.SmtpTarget,
+		pool:          NewProxyPool(poolCfg, override),
+		connectAllow:  cfg.ConnectAllow,
+		verbose:       cfg.Verbose,
+		smtpTraceBody: cfg.SmtpTraceBody,
+		localProxy:    cfg.LocalProxy,
+	}, nil
+}
+
+// watchConfig watches configPath and hot-swaps the live configuration on
+// Create/Write/Rename events, debouncing editor save bursts. On any error
+// reloading, the previous configuration is kept (fail closed).
+func watchConfig(configPath string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("⚠️ Could not start config watcher: %v", err)
+		return
+	}
+
+	dir := filepath.Dir(configPath)
+	if err := watcher.Add(dir); err != nil {
+		log.Printf("⚠️ Could not watch %s: %v", dir, err)
+		return
+	}
+
+	var debounce *time.Timer
+	reload := func() {
+		next, err := buildLiveConfig(configPath)
+		if err != nil {
+			log.Printf("⚠️ Config reload failed, keeping previous config: %v", err)
+			return
+		}
+		prev := currentConfig()
+		logConfigDiff(prev, next)
+		live.Store(next)
+		prev.pool.Close() // stop the old pool's probeLoop now that it's no longer live
+		log.Printf("✅ Config reloaded from %s", configPath)
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Base(event.Name) != filepath.Base(configPath) {
+				continue
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+			if debounce != nil {
+				debounce.Stop()
+			}
+			debounce = time.AfterFunc(200*time.Millisecond, reload)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("⚠️ Config watcher error: %v", err)
+		}
+	}
+}
+
+// logConfigDiff logs what changed between two live configs so operators can
+// see the effect of a reload without diffing the YAML by hand.
+func logConfigDiff(prev, next *liveConfig) {
+	if prev == nil {
+		return
+	}
+
+	for host := range next.httpTargets {
+		if _, ok := prev.httpTargets[host]; !ok {
+			log.Printf("ℹ️ http target added: %s", host)
+		}
+	}
+	for host := range prev.httpTargets {
+		if _, ok := next.httpTargets[host]; !ok {
+			log.Printf("ℹ️ http target removed: %s", host)
+		}
+	}
+
+	if prev.smtpTarget != next.smtpTarget {
+		log.Printf("ℹ️ smtp target changed: %s -> %s", prev.smtpTarget, next.smtpTarget)
+	}
+
+	if len(next.pool.backends) != len(prev.pool.backends) {
+		log.Printf("ℹ️ proxy pool size changed: %d -> %d backends", len(prev.pool.backends), len(next.pool.backends))
+	}
+
+	if len(prev.connectAllow) != len(next.connectAllow) {
+		log.Printf("ℹ️ connect_allow changed: %d -> %d patterns", len(prev.connectAllow), len(next.connectAllow))
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"time"
 
 	"golang.org/x/net/proxy"
-	"gopkg.in/yaml.v3"
 )
 
 // Constants replaced with variables that can be modified
@@ -29,10 +28,17 @@ var (
 
 // Config struct for YAML configuration
 type Config struct {
-	ProxyAddr  string            `yaml:"proxy_addr"`
-	LocalProxy string            `yaml:"local_proxy"`
-	HttpTargets map[string]string `yaml:"http_targets"`
-	SmtpTarget string            `yaml:"smtp_target"`
+	ProxyAddr     string            `yaml:"proxy_addr"`
+	LocalProxy    string            `yaml:"local_proxy"`
+	HttpTargets   map[string]string `yaml:"http_targets"`
+	HttpRules     []HttpRule        `yaml:"http_rules"`
+	SmtpTarget    string            `yaml:"smtp_target"`
+	ProxyPool     ProxyPoolConfig   `yaml:"proxy_pool"`
+	ConnectAllow  []string          `yaml:"connect_allow"`
+	Verbose       int               `yaml:"verbose"`
+	SmtpTraceBody bool              `yaml:"smtp_trace_body"`
+	ProxyFromEnv  bool              `yaml:"proxy_from_env"`
+	ProxyChain    []string          `yaml:"proxy_chain"`
 }
 
 var (
@@ -50,8 +56,21 @@ func main() {
 
 	log.Println("=== YAMN Proxy Start ===")
 
-	// Load configuration from YAML file if it exists
-	loadConfigFromYAML()
+	exePath, err := os.Executable()
+	if err != nil {
+		log.Fatal("Could not find executable path:", err)
+	}
+	configPath := filepath.Join(filepath.Dir(exePath), "yamn-proxy.yml")
+
+	initial, err := buildLiveConfig(configPath)
+	if err != nil {
+		log.Fatal("⚠️ Error loading config:", err)
+	}
+	live.Store(initial)
+	LocalProxy = initial.localProxy // only applied at startup; the listener can't be rebound on reload
+	log.Printf("✅ Configuration loaded from %s", configPath)
+
+	go watchConfig(configPath)
 
 	go func() {
 		listener, err := net.Listen("tcp", LocalProxy)
@@ -59,7 +78,7 @@ func main() {
 			log.Fatal("Proxy error:", err)
 		}
 		defer listener.Close()
-		
+
 		log.Printf("✅ Proxy listening on %s", LocalProxy)
 
 		for {
@@ -72,10 +91,6 @@ func main() {
 		}
 	}()
 
-	exePath, err := os.Executable()
-	if err != nil {
-		log.Fatal("Could not find executable path:", err)
-	}
 	yamnPath := filepath.Join(filepath.Dir(exePath), "yamn.exe")
 
 	args := os.Args[1:]
@@ -95,169 +110,145 @@ func main() {
 	}
 }
 
-// loadConfigFromYAML loads configuration from yamn-proxy.yml if it exists
-func loadConfigFromYAML() {
-	exePath, err := os.Executable()
-	if err != nil {
-		log.Println("⚠️ Could not determine executable path:", err)
-		return
-	}
-
-	configPath := filepath.Join(filepath.Dir(exePath), "yamn-proxy.yml")
-	
-	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Printf("ℹ️ No config file found at %s, using default values", configPath)
-		return
-	}
-
-	// Read config file
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		log.Printf("⚠️ Error reading config file %s: %v", configPath, err)
-		return
-	}
-
-	// Parse YAML
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		log.Printf("⚠️ Error parsing YAML config %s: %v", configPath, err)
-		return
-	}
-
-	// Update configuration values
-	if config.ProxyAddr != "" {
-		ProxyAddr = config.ProxyAddr
-		log.Printf("✅ Using proxy address from config: %s", ProxyAddr)
-	}
-
-	if config.LocalProxy != "" {
-		LocalProxy = config.LocalProxy
-		log.Printf("✅ Using local proxy from config: %s", LocalProxy)
-	}
-
-	if len(config.HttpTargets) > 0 {
-		httpTargets = config.HttpTargets
-		log.Printf("✅ Using HTTP targets from config: %d entries", len(httpTargets))
-	}
-
-	if config.SmtpTarget != "" {
-		smtpTarget = config.SmtpTarget
-		log.Printf("✅ Using SMTP target from config: %s", smtpTarget)
-	}
-
-	log.Printf("✅ Configuration loaded from %s", configPath)
-}
-
-func handleConnection(client net.Conn, log io.Writer) {
+func handleConnection(client net.Conn, out io.Writer) {
 	defer client.Close()
-	io.WriteString(log, "🔌 New connection\n")
+
+	cfg := currentConfig()
+	logger := NewTextLogger(out, cfg.verbose, cfg.smtpTraceBody)
+	logger.Eventf("🔌 New connection")
 
 	// Set initial deadline for connection type detection
 	client.SetDeadline(time.Now().Add(InitialTimeout))
 	defer client.SetDeadline(time.Time{})
 
 	reader := bufio.NewReader(client)
-	peek, err := reader.Peek(4)
+	peek, err := reader.Peek(8)
 	if err != nil {
-		io.WriteString(log, "📧 Starting SMTP session\n")
-		handleSMTP(client, log)
+		logger.Eventf("📧 Starting SMTP session")
+		handleSMTP(client, logger)
 		return
 	}
 
-	isHTTP := strings.HasPrefix(string(peek), "GET ") || strings.HasPrefix(string(peek), "POST ") || strings.HasPrefix(string(peek), "HEAD ") || strings.HasPrefix(string(peek), "CONNECT")
-	if isHTTP {
-		io.WriteString(log, "🌐 Starting HTTP session\n")
-		handleHTTP(reader, client, log)
-	} else {
-		io.WriteString(log, "📧 Non-HTTP request detected, treating as raw TCP (SMTP).\n")
-		handleSMTP(client, log)
+	switch {
+	case strings.HasPrefix(string(peek), "CONNECT "):
+		logger.Eventf("🌐 Starting CONNECT tunnel")
+		handleCONNECT(reader, client, logger)
+	case strings.HasPrefix(string(peek), "GET ") || strings.HasPrefix(string(peek), "POST ") || strings.HasPrefix(string(peek), "HEAD "):
+		logger.Eventf("🌐 Starting HTTP session")
+		handleHTTP(reader, client, logger)
+	default:
+		logger.Eventf("📧 Non-HTTP request detected, treating as raw TCP (SMTP).")
+		handleSMTP(client, logger)
 	}
 }
 
-func handleHTTP(reader io.Reader, client net.Conn, log io.Writer) {
+func handleHTTP(reader io.Reader, client net.Conn, logger Logger) {
+	start := time.Now()
+
 	req, err := http.ReadRequest(bufio.NewReader(reader))
 	if err != nil {
-		io.WriteString(log, "⚠️ HTTP parse error: "+err.Error()+"\n")
+		logger.Eventf("⚠️ HTTP parse error: %v", err)
 		return
 	}
 	defer req.Body.Close()
 
-	requestedURL := req.Host + req.URL.Path
-	
-	targetURLString, exists := httpTargets[requestedURL]
-	if !exists {
-		io.WriteString(log, "❌ No target for: "+requestedURL+"\n")
+	cfg := currentConfig()
+
+	if req.Method == http.MethodGet && req.URL.Path == "/status" {
+		serveStatus(client, cfg, logger)
 		return
 	}
 
-	io.WriteString(log, fmt.Sprintf("🔀 Routing from %s\n", requestedURL))
+	requestedURL := req.Host + req.URL.Path
+
+	targetURLString, via, matched := matchHttpRule(cfg.httpRules, requestedURL, req.Method)
+	if !matched {
+		logger.Eventf("❌ No target for: %s", requestedURL)
+		return
+	}
 
 	newReq, err := http.NewRequest(req.Method, targetURLString, req.Body)
 	if err != nil {
-		io.WriteString(log, "⚠️ New request creation error: "+err.Error()+"\n")
+		logger.Eventf("⚠️ New request creation error: %v", err)
 		return
 	}
 	newReq.Header = req.Header.Clone()
-	
-	Dialer, err := proxy.SOCKS5("tcp", ProxyAddr, nil, proxy.Direct)
+
+	dialer, backend, err := cfg.pool.GetVia(via, req.Host)
 	if err != nil {
-		io.WriteString(log, "⚠️ Proxy error: "+err.Error()+"\n")
+		logger.Eventf("⚠️ Proxy error: %v", err)
 		return
 	}
-	
+
 	proxyTransport := &http.Transport{
-		Dial: Dialer.Dial,
+		Dial: dialer.Dial,
 	}
 
 	httpClient := &http.Client{Transport: proxyTransport}
 
+	logger.HTTPDumpRequest(newReq)
+
 	resp, err := httpClient.Do(newReq)
 	if err != nil {
-		io.WriteString(log, "⚠️ Request failed: "+err.Error()+"\n")
+		logger.Eventf("⚠️ Request failed: %v", err)
 		return
 	}
 	defer resp.Body.Close()
 
+	logger.HTTPDumpResponse(resp)
+
 	if err := resp.Write(client); err != nil {
-		io.WriteString(log, "⚠️ Client write error: "+err.Error()+"\n")
+		logger.Eventf("⚠️ Client write error: %v", err)
 		return
 	}
 
-	io.WriteString(log, fmt.Sprintf("✅ Success (%d %s)\n", resp.StatusCode, resp.Status))
+	logger.HTTPSummary(req.Method, requestedURL, targetURLString, backend.Name, resp.StatusCode, time.Since(start))
 }
 
-func handleSMTP(client net.Conn, log io.Writer) {
+// serveStatus answers a GET /status request directly on the existing
+// LocalProxy listener, writing the pool's health JSON straight to client.
+func serveStatus(client net.Conn, cfg *liveConfig, logger Logger) {
+	data, err := cfg.pool.StatusJSON()
+	if err != nil {
+		logger.Eventf("⚠️ Status error: %v", err)
+		fmt.Fprint(client, "HTTP/1.1 500 Internal Server Error\r\n\r\n")
+		return
+	}
+	fmt.Fprintf(client, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		len(data), data)
+	logger.Eventf("✅ Served /status")
+}
+
+func handleSMTP(client net.Conn, logger Logger) {
 	// Reset deadline after initial detection
 	client.SetDeadline(time.Now().Add(IoTimeout))
 	defer client.SetDeadline(time.Time{})
 
-	io.WriteString(log, fmt.Sprintf("📧 Connecting to SMTP target\n"))
-	
-	// Create Tor dialer with longer timeout
-	dialer, err := proxy.SOCKS5("tcp", ProxyAddr, nil, &net.Dialer{
-		Timeout:   ConnectTimeout,
-		KeepAlive: 30 * time.Second,
-	})
+	cfg := currentConfig()
+	logger.Eventf("📧 Connecting to SMTP target")
+
+	// Pick an upstream backend from the pool
+	dialer, backend, err := cfg.pool.Get(cfg.smtpTarget)
 	if err != nil {
-		io.WriteString(log, "⚠️ SOCKS5 dialer creation error: "+err.Error()+"\n")
+		logger.Eventf("⚠️ Proxy error: %v", err)
 		return
 	}
+	logger.Eventf("🔀 Using backend %s (%s)", backend.Name, backend.Addr)
 
 	// Try to establish connection
 	var target net.Conn
 	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
 		ctx, cancel := context.WithTimeout(context.Background(), ConnectTimeout)
 		defer cancel()
-		
-		target, err = contextDialer.DialContext(ctx, "tcp", smtpTarget)
+
+		target, err = contextDialer.DialContext(ctx, "tcp", cfg.smtpTarget)
 	} else {
 		// Fallback for non-context dialer
-		target, err = dialer.Dial("tcp", smtpTarget)
+		target, err = dialer.Dial("tcp", cfg.smtpTarget)
 	}
 
 	if err != nil {
-		io.WriteString(log, "⚠️ Failed to connect to SMTP target via Tor: "+err.Error()+"\n")
+		logger.Eventf("⚠️ Failed to connect to SMTP target via Tor: %v", err)
 		return
 	}
 	defer target.Close()
@@ -272,14 +263,15 @@ func handleSMTP(client net.Conn, log io.Writer) {
 		tcpClient.SetKeepAlivePeriod(30 * time.Second)
 	}
 
-	io.WriteString(log, "🔗 Connection established, starting data transfer\n")
+	logger.Eventf("🔗 Connection established, starting data transfer")
 
 	// Setup error channels
 	errChan := make(chan error, 2)
 
-	// Client → Target
+	// Client → Target, traced for EHLO/MAIL FROM/RCPT TO/DATA
+	tracedClient := smtpCommandTracer(client, logger, cfg.smtpTraceBody)
 	go func() {
-		_, err := io.Copy(target, client)
+		_, err := io.Copy(target, tracedClient)
 		errChan <- err
 	}()
 
@@ -291,8 +283,8 @@ func handleSMTP(client net.Conn, log io.Writer) {
 
 	// Wait for first error
 	if err := <-errChan; err != nil {
-		io.WriteString(log, "⚠️ Connection error: "+err.Error()+"\n")
+		logger.Eventf("⚠️ Connection error: %v", err)
 	}
 
-	io.WriteString(log, "✅ SMTP connection closed\n")
+	logger.Eventf("✅ SMTP connection closed")
 }
\ No newline at end of file